@@ -0,0 +1,135 @@
+package main
+
+// annexb.go is a minimal H264 Annex-B bitstream reader: it scans start
+// codes, groups the NAL units that make up one access unit (SPS/PPS/SEI
+// coalesce with the slice NAL that follows them), and returns each access
+// unit ready for a single WriteSample call. V4L2 buffers aren't guaranteed
+// to hold exactly one access unit each (a keyframe buffer is commonly
+// SPS+PPS+IDR together), so the Hub can't assume that invariant on its own.
+
+import "bytes"
+
+// nalUnitType mirrors the low 5 bits of an H264 NAL header's first byte.
+type nalUnitType byte
+
+const (
+	nalSliceNonIDR nalUnitType = 1
+	nalSliceIDR    nalUnitType = 5
+	nalSEI         nalUnitType = 6
+	nalSPS         nalUnitType = 7
+	nalPPS         nalUnitType = 8
+	nalAUD         nalUnitType = 9
+)
+
+var (
+	startCode3 = []byte{0x00, 0x00, 0x01}
+	startCode4 = []byte{0x00, 0x00, 0x00, 0x01}
+)
+
+// nalUnit is one NAL unit's payload, start code excluded.
+type nalUnit struct {
+	kind nalUnitType
+	data []byte
+}
+
+// startCodeOffset locates one start code within a buffer.
+type startCodeOffset struct {
+	codeStart    int
+	payloadStart int
+}
+
+// findStartCodes locates every Annex-B start code (3- or 4-byte form) in buf.
+func findStartCodes(buf []byte) []startCodeOffset {
+	var offsets []startCodeOffset
+
+	for i := 0; i < len(buf); {
+		rest := buf[i:]
+		switch {
+		case bytes.HasPrefix(rest, startCode4):
+			offsets = append(offsets, startCodeOffset{codeStart: i, payloadStart: i + 4})
+			i += 4
+		case bytes.HasPrefix(rest, startCode3):
+			offsets = append(offsets, startCodeOffset{codeStart: i, payloadStart: i + 3})
+			i += 3
+		default:
+			i++
+		}
+	}
+
+	return offsets
+}
+
+// splitNALUnits scans an Annex-B buffer for start codes and returns each NAL
+// unit it finds, in order.
+func splitNALUnits(buf []byte) []nalUnit {
+	var units []nalUnit
+
+	offsets := findStartCodes(buf)
+	for i, off := range offsets {
+		end := len(buf)
+		if i+1 < len(offsets) {
+			end = offsets[i+1].codeStart
+		}
+		payload := buf[off.payloadStart:end]
+		if len(payload) == 0 {
+			continue
+		}
+		units = append(units, nalUnit{kind: nalUnitType(payload[0] & 0x1f), data: payload})
+	}
+
+	return units
+}
+
+// isVCL reports whether kind is a coded slice NAL, i.e. the NAL that
+// terminates an access unit.
+func isVCL(kind nalUnitType) bool {
+	return kind == nalSliceNonIDR || kind == nalSliceIDR
+}
+
+// accessUnit is everything Pion needs for one WriteSample call: an Annex-B
+// encoded picture, with any parameter sets it carries attached.
+type accessUnit struct {
+	data  []byte
+	isIDR bool
+}
+
+// coalesceAccessUnits regroups a flat list of NAL units (as produced by
+// splitNALUnits) back into Annex-B encoded access units: any AUD/SEI/SPS/PPS
+// NALs accumulate until the slice NAL that completes the picture arrives, at
+// which point they're flushed together as one access unit. A V4L2 driver
+// isn't guaranteed to deliver SPS/PPS and the IDR slice in the same buffer,
+// so any non-VCL NALs still waiting for their slice when units runs out are
+// returned as pending, for the caller to pass back in on the next read
+// rather than silently dropping them.
+func coalesceAccessUnits(pending, units []nalUnit) (aus []accessUnit, stillPending []nalUnit) {
+	cur := append([]nalUnit{}, pending...)
+
+	for _, u := range units {
+		cur = append(cur, u)
+		if isVCL(u.kind) {
+			aus = append(aus, buildAccessUnit(cur))
+			cur = nil
+		}
+	}
+
+	return aus, cur
+}
+
+// buildAccessUnit re-encodes a run of NAL units (parameter sets plus the
+// slice that completes them) as a single Annex-B buffer.
+func buildAccessUnit(units []nalUnit) accessUnit {
+	var buf bytes.Buffer
+	isIDR := false
+
+	for _, u := range units {
+		buf.Write(startCode4)
+		buf.Write(u.data)
+		if u.kind == nalSliceIDR {
+			isIDR = true
+		}
+	}
+
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	return accessUnit{data: data, isIDR: isIDR}
+}
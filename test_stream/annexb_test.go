@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func annexB(chunks ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, c := range chunks {
+		buf.Write(startCode4)
+		buf.Write(c)
+	}
+	return buf.Bytes()
+}
+
+func TestSplitNALUnits(t *testing.T) {
+	sps := []byte{0x67, 0xaa}
+	pps := []byte{0x68, 0xbb}
+	idr := []byte{0x65, 0xcc, 0xdd}
+
+	units := splitNALUnits(annexB(sps, pps, idr))
+
+	want := []nalUnit{
+		{kind: nalSPS, data: sps},
+		{kind: nalPPS, data: pps},
+		{kind: nalSliceIDR, data: idr},
+	}
+	if !reflect.DeepEqual(units, want) {
+		t.Fatalf("splitNALUnits = %+v, want %+v", units, want)
+	}
+}
+
+func TestSplitNALUnitsMixedStartCodes(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(startCode3)
+	buf.Write([]byte{0x67, 0xaa})
+	buf.Write(startCode4)
+	buf.Write([]byte{0x65, 0xcc})
+
+	units := splitNALUnits(buf.Bytes())
+	if len(units) != 2 {
+		t.Fatalf("got %d units, want 2: %+v", len(units), units)
+	}
+	if units[0].kind != nalSPS || units[1].kind != nalSliceIDR {
+		t.Fatalf("unexpected kinds: %+v", units)
+	}
+}
+
+func TestSplitNALUnitsEmpty(t *testing.T) {
+	if units := splitNALUnits(nil); units != nil {
+		t.Fatalf("splitNALUnits(nil) = %+v, want nil", units)
+	}
+}
+
+func TestCoalesceAccessUnitsSingleBuffer(t *testing.T) {
+	sps := []byte{0x67, 0xaa}
+	pps := []byte{0x68, 0xbb}
+	idr := []byte{0x65, 0xcc}
+
+	aus, pending := coalesceAccessUnits(nil, splitNALUnits(annexB(sps, pps, idr)))
+
+	if len(pending) != 0 {
+		t.Fatalf("pending = %+v, want none", pending)
+	}
+	if len(aus) != 1 {
+		t.Fatalf("got %d access units, want 1: %+v", len(aus), aus)
+	}
+	if !aus[0].isIDR {
+		t.Fatalf("access unit not marked as IDR: %+v", aus[0])
+	}
+	if got := buildAccessUnit(splitNALUnits(aus[0].data)); !reflect.DeepEqual(got.data, aus[0].data) {
+		t.Fatalf("access unit data didn't round-trip through splitNALUnits")
+	}
+}
+
+// TestCoalesceAccessUnitsCrossBuffer covers the case a V4L2 buffer split the
+// parameter sets from the IDR slice that completes them: the SPS/PPS must
+// carry over as pending rather than being dropped.
+func TestCoalesceAccessUnitsCrossBuffer(t *testing.T) {
+	sps := []byte{0x67, 0xaa}
+	pps := []byte{0x68, 0xbb}
+	idr := []byte{0x65, 0xcc}
+
+	aus, pending := coalesceAccessUnits(nil, splitNALUnits(annexB(sps, pps)))
+	if len(aus) != 0 {
+		t.Fatalf("got %d access units before any slice NAL arrived, want 0: %+v", len(aus), aus)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("pending = %+v, want the SPS and PPS NALs", pending)
+	}
+
+	aus, pending = coalesceAccessUnits(pending, splitNALUnits(annexB(idr)))
+	if len(pending) != 0 {
+		t.Fatalf("pending after the slice NAL = %+v, want none", pending)
+	}
+	if len(aus) != 1 || !aus[0].isIDR {
+		t.Fatalf("got %+v, want a single IDR access unit", aus)
+	}
+
+	got := splitNALUnits(aus[0].data)
+	wantKinds := []nalUnitType{nalSPS, nalPPS, nalSliceIDR}
+	if len(got) != len(wantKinds) {
+		t.Fatalf("coalesced access unit has %d NALs, want %d: %+v", len(got), len(wantKinds), got)
+	}
+	for i, k := range wantKinds {
+		if got[i].kind != k {
+			t.Fatalf("NAL %d kind = %v, want %v", i, got[i].kind, k)
+		}
+	}
+}
+
+func TestCoalesceAccessUnitsMultipleSlicesInOneBuffer(t *testing.T) {
+	idr1 := []byte{0x65, 0x01}
+	idr2 := []byte{0x65, 0x02}
+
+	aus, pending := coalesceAccessUnits(nil, splitNALUnits(annexB(idr1, idr2)))
+	if len(pending) != 0 {
+		t.Fatalf("pending = %+v, want none", pending)
+	}
+	if len(aus) != 2 {
+		t.Fatalf("got %d access units, want 2: %+v", len(aus), aus)
+	}
+}
+
+func TestBuildAccessUnitDetectsIDR(t *testing.T) {
+	nonIDR := buildAccessUnit([]nalUnit{{kind: nalSliceNonIDR, data: []byte{0x41}}})
+	if nonIDR.isIDR {
+		t.Fatalf("non-IDR slice marked as IDR")
+	}
+
+	idr := buildAccessUnit([]nalUnit{{kind: nalSliceIDR, data: []byte{0x65}}})
+	if !idr.isIDR {
+		t.Fatalf("IDR slice not marked as IDR")
+	}
+}
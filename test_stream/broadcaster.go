@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// subscriberBufferSize bounds how far a slow viewer can fall behind before
+// the Hub starts dropping its oldest buffered frame rather than blocking the
+// producer.
+const subscriberBufferSize = 8
+
+// sample is one H264 access unit ready to hand to a subscriber, along with
+// how long it should be displayed for.
+type sample struct {
+	data     []byte
+	duration time.Duration
+}
+
+// minSampleDuration and maxSampleDuration bound the inter-arrival gap used
+// to derive a sample's duration, so a scheduling hiccup (or the very first
+// frame, with nothing to compare against) doesn't produce a wildly wrong
+// value; 30fps is the device's configured rate and a sane fallback.
+const (
+	minSampleDuration = time.Second / 60
+	maxSampleDuration = time.Second / 10
+	fallbackDuration  = time.Second / 30
+)
+
+// subscriber is a single viewer's private, buffered view onto the broadcast.
+type subscriber struct {
+	id int
+	ch chan sample
+}
+
+// Hub owns the single camera device, reads its output exactly once, and fans
+// frames out to any number of subscribers. It also caches the most recent
+// IDR so a newly-joined subscriber can start decoding immediately instead of
+// waiting for the next keyframe.
+type Hub struct {
+	mu         sync.Mutex
+	subs       map[int]*subscriber
+	nextID     int
+	lastSPSPPS []byte
+	lastIDR    []byte
+
+	// frameCount/byteCount/droppedCount feed stats() for the "telemetry"
+	// data channel's OSD stats; they're updated from broadcast() so they
+	// stay accurate regardless of which entry point (offer/whep) is live.
+	frameCount   uint64
+	byteCount    uint64
+	droppedCount uint64
+
+	statsMu     sync.Mutex
+	statsAt     time.Time
+	statsFrames uint64
+	statsBytes  uint64
+}
+
+// hubStats is a point-in-time snapshot of encoder throughput for the
+// "telemetry" data channel.
+type hubStats struct {
+	fps         float64
+	bitrateKbps float64
+	dropped     uint64
+}
+
+// stats computes fps/bitrate from the frame and byte counters observed since
+// the previous call, and returns the running dropped-frame total.
+func (h *Hub) stats() hubStats {
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+
+	frames := atomic.LoadUint64(&h.frameCount)
+	bytes := atomic.LoadUint64(&h.byteCount)
+	now := time.Now()
+
+	var fps, kbps float64
+	if !h.statsAt.IsZero() {
+		if elapsed := now.Sub(h.statsAt).Seconds(); elapsed > 0 {
+			fps = float64(frames-h.statsFrames) / elapsed
+			kbps = float64(bytes-h.statsBytes) * 8 / 1000 / elapsed
+		}
+	}
+
+	h.statsAt = now
+	h.statsFrames = frames
+	h.statsBytes = bytes
+
+	return hubStats{fps: fps, bitrateKbps: kbps, dropped: atomic.LoadUint64(&h.droppedCount)}
+}
+
+var (
+	hub     *Hub
+	hubOnce sync.Once
+)
+
+// getHub lazily starts the Hub's read loop against the shared device the
+// first time it's needed and returns the singleton thereafter.
+func getHub() *Hub {
+	hubOnce.Do(func() {
+		hub = &Hub{subs: make(map[int]*subscriber)}
+		go hub.run()
+		go hub.watchKeyframes()
+	})
+	return hub
+}
+
+// requireH264Passthrough fatals if initDevice ended up selecting a capture
+// format this pipeline can't actually parse as H264 Annex-B. pickPixelFormat
+// already refuses to select one, but Hub.run asserts it here too rather than
+// trusting dev.GetOutput() blindly.
+func requireH264Passthrough() {
+	if selectedCodec.needsTranscode {
+		log.Fatalf("Hub: selected codec %s needs transcoding, which isn't implemented", selectedCodec.name)
+	}
+}
+
+func (h *Hub) run() {
+	requireH264Passthrough()
+
+	var lastArrival time.Time
+	var pending []nalUnit
+
+	for raw := range dev.GetOutput() {
+		if len(raw) == 0 {
+			continue
+		}
+
+		now := time.Now()
+		var gap time.Duration
+		if !lastArrival.IsZero() {
+			gap = now.Sub(lastArrival)
+		}
+		lastArrival = now
+
+		var aus []accessUnit
+		aus, pending = coalesceAccessUnits(pending, splitNALUnits(raw))
+		for _, au := range aus {
+			h.cache(au)
+			h.broadcast(sample{data: au.data, duration: sampleDuration(gap)})
+		}
+	}
+	log.Println("Hub: device output closed, shutting down")
+}
+
+// sampleDuration estimates a WriteSample duration from the wall-clock gap
+// between successive V4L2 buffer arrivals; a gap outside
+// [minSampleDuration, maxSampleDuration] is replaced by fallbackDuration. This is
+// an estimate, not the device's own per-frame timestamp: go4vl's simple
+// GetOutput() channel used here doesn't expose one (GetFrames() does, for a
+// future revision that wants true hardware timestamps).
+func sampleDuration(gap time.Duration) time.Duration {
+	if gap < minSampleDuration || gap > maxSampleDuration {
+		return fallbackDuration
+	}
+	return gap
+}
+
+// cache remembers the latest parameter sets and IDR access units so
+// subscribe() can prime new subscribers without waiting for the next
+// keyframe.
+func (h *Hub) cache(au accessUnit) {
+	params := parameterSets(au.data)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if params != nil {
+		h.lastSPSPPS = params
+	}
+	if au.isIDR {
+		h.lastIDR = au.data
+	}
+}
+
+// parameterSets returns the SPS and PPS NALs an access unit carries,
+// re-encoded as one Annex-B buffer, or nil if it carries none.
+// coalesceAccessUnits attaches parameter sets to the slice that follows
+// them, so they normally arrive inside an IDR access unit.
+func parameterSets(data []byte) []byte {
+	var params []nalUnit
+	for _, u := range splitNALUnits(data) {
+		if u.kind == nalSPS || u.kind == nalPPS {
+			params = append(params, u)
+		}
+	}
+	if params == nil {
+		return nil
+	}
+	return buildAccessUnit(params).data
+}
+
+// broadcast fans a sample out to every subscriber. A subscriber that's
+// behind has its oldest buffered sample dropped to make room, rather than
+// blocking the single producer goroutine.
+func (h *Hub) broadcast(s sample) {
+	atomic.AddUint64(&h.frameCount, 1)
+	atomic.AddUint64(&h.byteCount, uint64(len(s.data)))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, sub := range h.subs {
+		select {
+		case sub.ch <- s:
+		default:
+			select {
+			case <-sub.ch:
+				atomic.AddUint64(&h.droppedCount, 1)
+			default:
+			}
+			select {
+			case sub.ch <- s:
+			default:
+			}
+		}
+	}
+}
+
+// subscribe registers a new subscriber and immediately primes it with the
+// cached keyframe, if any, so it can render something before the next IDR.
+func (h *Hub) subscribe() *subscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	sub := &subscriber{id: h.nextID, ch: make(chan sample, subscriberBufferSize)}
+	h.subs[sub.id] = sub
+
+	if h.lastSPSPPS != nil {
+		sub.ch <- sample{data: h.lastSPSPPS, duration: 0}
+	}
+	if h.lastIDR != nil {
+		sub.ch <- sample{data: h.lastIDR, duration: fallbackDuration}
+	}
+
+	return sub
+}
+
+func (h *Hub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, sub.id)
+	close(sub.ch)
+}
+
+// streamToTrack feeds track from a private Hub subscription until ctx is
+// cancelled or the Hub shuts down, so any number of viewers (via /offer or
+// /whep) can watch concurrently without stealing frames from each other.
+func streamToTrack(ctx context.Context, track *webrtc.TrackLocalStaticSample) {
+	sub := getHub().subscribe()
+	defer getHub().unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			if err := track.WriteSample(media.Sample{Data: s.data, Duration: s.duration}); err != nil {
+				log.Printf("videoTrack WriteSample error: %v", err)
+				return
+			}
+		}
+	}
+}
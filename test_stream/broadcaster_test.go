@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestHub() *Hub {
+	return &Hub{subs: make(map[int]*subscriber)}
+}
+
+func TestHubSubscribePrimesWithCachedKeyframe(t *testing.T) {
+	h := newTestHub()
+	h.lastSPSPPS = []byte("spspps")
+	h.lastIDR = []byte("idr")
+
+	sub := h.subscribe()
+	defer h.unsubscribe(sub)
+
+	first := <-sub.ch
+	if string(first.data) != "spspps" || first.duration != 0 {
+		t.Fatalf("first primed sample = %+v, want spspps with zero duration", first)
+	}
+
+	second := <-sub.ch
+	if string(second.data) != "idr" || second.duration != fallbackDuration {
+		t.Fatalf("second primed sample = %+v, want idr with fallbackDuration", second)
+	}
+}
+
+func TestHubSubscribeNoCacheYet(t *testing.T) {
+	h := newTestHub()
+	sub := h.subscribe()
+	defer h.unsubscribe(sub)
+
+	select {
+	case s := <-sub.ch:
+		t.Fatalf("got unexpected sample %+v on a subscriber with nothing cached yet", s)
+	default:
+	}
+}
+
+func TestHubBroadcastDropsOldestWhenSubscriberIsBehind(t *testing.T) {
+	h := newTestHub()
+	sub := &subscriber{id: 1, ch: make(chan sample, 2)}
+	h.subs[sub.id] = sub
+
+	for i := 0; i < 3; i++ {
+		h.broadcast(sample{data: []byte{byte(i)}})
+	}
+
+	if got := h.droppedCount; got != 1 {
+		t.Fatalf("droppedCount = %d, want 1", got)
+	}
+
+	first := <-sub.ch
+	second := <-sub.ch
+	if first.data[0] != 1 || second.data[0] != 2 {
+		t.Fatalf("got samples %v, %v; want the oldest (0) dropped, 1 and 2 kept", first.data, second.data)
+	}
+}
+
+func TestHubBroadcastFansOutToAllSubscribers(t *testing.T) {
+	h := newTestHub()
+	a := &subscriber{id: 1, ch: make(chan sample, subscriberBufferSize)}
+	b := &subscriber{id: 2, ch: make(chan sample, subscriberBufferSize)}
+	h.subs[a.id] = a
+	h.subs[b.id] = b
+
+	h.broadcast(sample{data: []byte("frame")})
+
+	for _, sub := range []*subscriber{a, b} {
+		select {
+		case s := <-sub.ch:
+			if string(s.data) != "frame" {
+				t.Fatalf("subscriber %d got %q, want frame", sub.id, s.data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("subscriber %d never received the broadcast sample", sub.id)
+		}
+	}
+}
+
+func TestHubUnsubscribeRemovesFromFanOut(t *testing.T) {
+	h := newTestHub()
+	sub := h.subscribe()
+	h.unsubscribe(sub)
+
+	if _, ok := h.subs[sub.id]; ok {
+		t.Fatal("subscriber still present after unsubscribe")
+	}
+
+	h.broadcast(sample{data: []byte("frame")})
+}
@@ -0,0 +1,91 @@
+package main
+
+// codec.go enumerates the pixel formats the camera can actually produce and
+// checks them against a priority table of formats we have a real H264
+// pipeline for. As of this revision that pipeline is H264 passthrough only:
+// no MJPEG or YUYV encoder is implemented, so a camera whose best format is
+// one of those still fails initDevice, the same as a hard-coded H264 check
+// would. What this buys over that hard-coded check is a named, extensible
+// spot (codecPriority) for a real mjpeg-to-h264/yuyv-to-h264 encoder to land
+// later, and an error message that says which format was found and why it
+// was rejected instead of just "wrong format". It does not mirror
+// pion/mediadevices' CodecSelector in behavior, only in shape.
+
+import (
+	"fmt"
+
+	"github.com/vladimirvivien/go4vl/device"
+	"github.com/vladimirvivien/go4vl/v4l2"
+)
+
+// encoderBuilder describes one path from a camera pixel format to the H264
+// NALs the Hub expects. needsTranscode marks formats that would require a
+// decode+encode step we haven't built yet.
+type encoderBuilder struct {
+	name           string
+	pixelFormat    v4l2.FourCCType
+	priority       int
+	needsTranscode bool
+}
+
+// codecPriority lists the pixel formats we know how to turn into H264,
+// highest priority (least work, best quality) first. Only h264-passthrough
+// has a working encoder path; the MJPEG/YUYV entries are unimplemented
+// placeholders (needsTranscode: true) that record the intended priority
+// order for whoever builds their encoders next — selecting one today is
+// still a hard error, not a fallback.
+var codecPriority = []encoderBuilder{
+	{name: "h264-passthrough", pixelFormat: v4l2.PixelFmtH264, priority: 100},
+	{name: "mjpeg-to-h264", pixelFormat: v4l2.PixelFmtMJPEG, priority: 50, needsTranscode: true},
+	{name: "yuyv-to-h264", pixelFormat: v4l2.PixelFmtYUYV, priority: 10, needsTranscode: true},
+}
+
+// selectedCodec records which builder initDevice settled on. Hub.run checks
+// it before trusting dev.GetOutput() to be H264 Annex-B (see
+// requireH264Passthrough in broadcaster.go).
+var selectedCodec encoderBuilder
+
+// pickPixelFormat opens path just long enough to enumerate its supported
+// capture formats, and returns the highest-priority one we have a working
+// encoder path for. A camera whose best match still needs a transcode we
+// haven't implemented is reported as an error rather than silently selected.
+func pickPixelFormat(path string) (encoderBuilder, error) {
+	probe, err := device.Open(path)
+	if err != nil {
+		return encoderBuilder{}, fmt.Errorf("probe open: %w", err)
+	}
+	defer probe.Close()
+
+	descs, err := v4l2.GetAllFormatDescriptions(probe.Fd())
+	if err != nil {
+		return encoderBuilder{}, fmt.Errorf("enumerate formats: %w", err)
+	}
+
+	supported := make(map[v4l2.FourCCType]bool, len(descs))
+	for _, d := range descs {
+		supported[d.PixelFormat] = true
+	}
+
+	return selectBestFormat(supported)
+}
+
+// selectBestFormat is the pure priority-selection part of pickPixelFormat,
+// split out so it can be unit tested without a real V4L2 device to probe.
+func selectBestFormat(supported map[v4l2.FourCCType]bool) (encoderBuilder, error) {
+	var best encoderBuilder
+	for _, candidate := range codecPriority {
+		if supported[candidate.pixelFormat] && candidate.priority > best.priority {
+			best = candidate
+		}
+	}
+	if best.name == "" {
+		return encoderBuilder{}, fmt.Errorf("no supported pixel format has a registered encoder")
+	}
+	if best.needsTranscode {
+		pf := best.pixelFormat
+		fourCC := string([]byte{byte(pf), byte(pf >> 8), byte(pf >> 16), byte(pf >> 24)})
+		return encoderBuilder{}, fmt.Errorf("camera's best format is %s, but %s transcoding isn't implemented yet; only native H264 capture is supported", fourCC, best.name)
+	}
+
+	return best, nil
+}
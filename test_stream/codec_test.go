@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/go4vl/v4l2"
+)
+
+func TestSelectBestFormatPrefersH264(t *testing.T) {
+	supported := map[v4l2.FourCCType]bool{
+		v4l2.PixelFmtYUYV:  true,
+		v4l2.PixelFmtMJPEG: true,
+		v4l2.PixelFmtH264:  true,
+	}
+
+	got, err := selectBestFormat(supported)
+	if err != nil {
+		t.Fatalf("selectBestFormat returned error: %v", err)
+	}
+	if got.name != "h264-passthrough" {
+		t.Fatalf("got %q, want h264-passthrough", got.name)
+	}
+}
+
+func TestSelectBestFormatRejectsTranscodeOnly(t *testing.T) {
+	supported := map[v4l2.FourCCType]bool{
+		v4l2.PixelFmtYUYV:  true,
+		v4l2.PixelFmtMJPEG: true,
+	}
+
+	_, err := selectBestFormat(supported)
+	if err == nil {
+		t.Fatal("expected an error when the camera's best format needs an unimplemented transcode")
+	}
+	if !strings.Contains(err.Error(), "mjpeg-to-h264") {
+		t.Fatalf("error %q doesn't name the rejected format", err)
+	}
+}
+
+func TestSelectBestFormatNoneSupported(t *testing.T) {
+	_, err := selectBestFormat(map[v4l2.FourCCType]bool{})
+	if err == nil {
+		t.Fatal("expected an error when no known pixel format is supported")
+	}
+}
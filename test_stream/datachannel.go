@@ -0,0 +1,140 @@
+package main
+
+// datachannel.go wires the "input" and "telemetry" RTCDataChannels into a
+// PeerConnection so gamepad HID reports and OSD stats ride the same
+// ICE-negotiated transport as video, instead of requiring the separate
+// /gamepad WebSocket the MJPEG server exposes.
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const hidDevicePath = "/dev/hidg0"
+
+// telemetryInterval is how often "telemetry" samples are pushed to the
+// browser for its on-screen display.
+const telemetryInterval = time.Second
+
+// telemetrySample is what the "telemetry" channel sends the browser.
+type telemetrySample struct {
+	EncoderFPS    float64 `json:"encoderFps"`
+	DroppedFrames uint64  `json:"droppedFrames"`
+	RTTMillis     float64 `json:"rttMs"`
+	BitrateKbps   float64 `json:"bitrateKbps"`
+}
+
+// addInputDataChannels negotiates the "input" and "telemetry" data channels
+// on pc. "input" carries the same JSON-encoded HID report format the
+// /gamepad WebSocket used; "telemetry" is unreliable/unordered and streams
+// encoder stats for an OSD.
+func addInputDataChannels(pc *webrtc.PeerConnection) {
+	input, err := pc.CreateDataChannel("input", nil)
+	if err != nil {
+		log.Printf("CreateDataChannel(input) error: %v", err)
+	} else {
+		// hidFile is written from OnOpen's goroutine and read from OnMessage's
+		// and OnClose's, which pion runs on the channel's own readLoop()
+		// goroutine; a plain *os.File var has no happens-before relationship
+		// between those, so it's an atomic.Pointer rather than a bare field.
+		var hidFile atomic.Pointer[os.File]
+
+		input.OnOpen(func() {
+			f, err := os.OpenFile(hidDevicePath, os.O_RDWR, 0644)
+			if err != nil {
+				log.Printf("HID device open error: %v", err)
+				return
+			}
+			hidFile.Store(f)
+		})
+
+		input.OnMessage(func(msg webrtc.DataChannelMessage) {
+			f := hidFile.Load()
+			if f == nil {
+				return
+			}
+			if err := writeHIDReport(f, msg.Data); err != nil {
+				log.Printf("HID write error: %v", err)
+			}
+		})
+
+		input.OnClose(func() {
+			if f := hidFile.Load(); f != nil {
+				f.Close()
+			}
+		})
+	}
+
+	ordered := false
+	maxRetransmits := uint16(0)
+	telemetry, err := pc.CreateDataChannel("telemetry", &webrtc.DataChannelInit{
+		Ordered:        &ordered,
+		MaxRetransmits: &maxRetransmits,
+	})
+	if err != nil {
+		log.Printf("CreateDataChannel(telemetry) error: %v", err)
+		return
+	}
+	telemetry.OnOpen(func() {
+		go streamTelemetry(pc, telemetry)
+	})
+}
+
+// writeHIDReport unmarshals the same JSON-encoded report the /gamepad
+// WebSocket accepts and writes it straight through to the gadget device,
+// reusing the fd opened for the lifetime of the "input" channel rather than
+// opening it per message.
+func writeHIDReport(f *os.File, raw []byte) error {
+	var report []byte
+	if err := json.Unmarshal(raw, &report); err != nil {
+		return err
+	}
+
+	_, err := f.Write(report)
+	return err
+}
+
+// streamTelemetry periodically pulls stats from the Hub and pc's RTCP
+// receiver reports and pushes them to the browser over dc, until pc closes.
+func streamTelemetry(pc *webrtc.PeerConnection, dc *webrtc.DataChannel) {
+	ticker := time.NewTicker(telemetryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		switch pc.ConnectionState() {
+		case webrtc.PeerConnectionStateClosed, webrtc.PeerConnectionStateFailed:
+			return
+		}
+
+		stats := getHub().stats()
+		data, err := json.Marshal(telemetrySample{
+			EncoderFPS:    stats.fps,
+			DroppedFrames: stats.dropped,
+			RTTMillis:     rttFromStats(pc),
+			BitrateKbps:   stats.bitrateKbps,
+		})
+		if err != nil {
+			log.Printf("telemetry marshal error: %v", err)
+			continue
+		}
+		if err := dc.Send(data); err != nil {
+			return
+		}
+	}
+}
+
+// rttFromStats pulls the RTT pion measured from RTCP receiver reports on
+// pc's remote-inbound RTP stream, if any is available yet.
+func rttFromStats(pc *webrtc.PeerConnection) float64 {
+	for _, s := range pc.GetStats() {
+		if rr, ok := s.(webrtc.RemoteInboundRTPStreamStats); ok {
+			return rr.RoundTripTime * 1000
+		}
+	}
+	return 0
+}
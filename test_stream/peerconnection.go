@@ -0,0 +1,66 @@
+package main
+
+// peerconnection.go holds the PeerConnection setup shared by /offer and
+// /whep: both hand the viewer a send-only H264 video track, just via
+// different signaling envelopes.
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// newVideoPeerConnection builds a PeerConnection configured for a send-only
+// H264 video track: a MediaEngine with H264 registered, a sendonly video
+// transceiver, and a TrackLocalStaticSample already attached. The caller
+// gets back the PeerConnection, the track to write samples to, and the
+// RTPSender to watch for RTCP feedback.
+func newVideoPeerConnection() (*webrtc.PeerConnection, *webrtc.TrackLocalStaticSample, *webrtc.RTPSender, error) {
+	m := webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return nil, nil, nil, fmt.Errorf("RegisterDefaultCodecs failed: %w", err)
+	}
+	h264 := webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeH264,
+			ClockRate:   90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		},
+		PayloadType: 0,
+	}
+	if err := m.RegisterCodec(h264, webrtc.RTPCodecTypeVideo); err != nil {
+		log.Printf("warning: RegisterCodec(H264) returned: %v", err)
+	}
+
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(&m))
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("NewPeerConnection error: %w", err)
+	}
+
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionSendonly,
+	}); err != nil {
+		pc.Close()
+		return nil, nil, nil, fmt.Errorf("AddTransceiverFromKind error: %w", err)
+	}
+
+	videoTrack, err := webrtc.NewTrackLocalStaticSample(
+		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264},
+		"video", "pion",
+	)
+	if err != nil {
+		pc.Close()
+		return nil, nil, nil, fmt.Errorf("NewTrackLocalStaticSample error: %w", err)
+	}
+
+	sender, err := pc.AddTrack(videoTrack)
+	if err != nil {
+		pc.Close()
+		return nil, nil, nil, fmt.Errorf("AddTrack error: %w", err)
+	}
+
+	return pc, videoTrack, sender, nil
+}
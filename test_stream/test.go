@@ -8,10 +8,8 @@ import (
 	"log"
 	"net/http"
 	"sync"
-	"time"
 
 	"github.com/pion/webrtc/v4"
-	"github.com/pion/webrtc/v4/pkg/media"
 	"github.com/vladimirvivien/go4vl/device"
 	"github.com/vladimirvivien/go4vl/v4l2"
 )
@@ -21,25 +19,31 @@ var (
 	once sync.Once
 )
 
-// initDevice opens /dev/video0 once, prefers H264 output. Returns nil and logs fatal if no H264.
+// initDevice opens /dev/video0 once, selecting the best pixel format the
+// camera actually supports (see codec.go) instead of assuming H264.
 func initDevice() *device.Device {
 	once.Do(func() {
+		codec, err := pickPixelFormat("/dev/video0")
+		if err != nil {
+			log.Fatalf("codec selection failed: %v", err)
+		}
+		selectedCodec = codec
 
-		// Open device with chosen pixfmt and FPS
-		dev, err := device.Open(
+		d, err := device.Open(
 			"/dev/video0",
-			device.WithPixFormat(v4l2.PixFormat{PixelFormat: v4l2.PixelFmtH264, Width: 1280, Height: 720}),
+			device.WithPixFormat(v4l2.PixFormat{PixelFormat: codec.pixelFormat, Width: 1280, Height: 720}),
 			device.WithFPS(30),
 		)
 		if err != nil {
 			log.Fatalf("failed to open device: %v", err)
 		}
 
-		if err := dev.Start(context.TODO()); err != nil {
+		if err := d.Start(context.TODO()); err != nil {
 			log.Fatalf("failed to start stream: %v", err)
 		}
 
-		log.Printf("Camera started: %dx%d (H264)", 1280, 720)
+		dev = d
+		log.Printf("Camera started: %dx%d (%s)", 1280, 720, codec.name)
 	})
 
 	return dev
@@ -49,6 +53,12 @@ func main() {
 	http.HandleFunc("/offer", handleOffer)
 	// http.Handle("/", http.FileServer(http.Dir(".")))
 
+	// WHIP/WHEP-compliant signaling, alongside the ad-hoc /offer above, so
+	// off-the-shelf WHEP players (OBS, GStreamer whipsink, browser libs) can
+	// connect without speaking our custom JSON envelope.
+	http.HandleFunc("/whep", handleWhep)
+	http.HandleFunc(whepResourcePrefix, handleWhep)
+
 	fmt.Println("Running on :9090")
 	log.Fatal(http.ListenAndServe(":9090", nil))
 }
@@ -75,59 +85,17 @@ func handleOffer(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("Received offer: type=%s sdp_len=%d", offer.Type, len(offer.SDP))
 
-	// WebRTC: register H264 codec explicitly into the MediaEngine
-	m := webrtc.MediaEngine{}
-	// register default codecs (VP8, etc.) then ensure H264 codec available for browsers
-	if err := m.RegisterDefaultCodecs(); err != nil {
-		http.Error(w, "RegisterDefaultCodecs failed: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	// Add common H264 profile-level fmtp (browsers usually accept this)
-	h264 := webrtc.RTPCodecParameters{
-		RTPCodecCapability: webrtc.RTPCodecCapability{
-			MimeType:     webrtc.MimeTypeH264,
-			ClockRate:    90000,
-			Channels:     0,
-			SDPFmtpLine:  "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
-			RTCPFeedback: nil,
-		},
-		PayloadType: 0,
-	}
-	if err := m.RegisterCodec(h264, webrtc.RTPCodecTypeVideo); err != nil {
-		// non-fatal: continue but log
-		log.Printf("warning: RegisterCodec(H264) returned: %v", err)
-	}
-
-	api := webrtc.NewAPI(webrtc.WithMediaEngine(&m))
-
-	// Create PeerConnection
-	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	pc, videoTrack, sender, err := newVideoPeerConnection()
 	if err != nil {
-		http.Error(w, "NewPeerConnection error: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	go watchRTCP(sender, getHub())
 
-	// Important: add transceiver BEFORE setting remote description so browser includes m=video
-	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
-		Direction: webrtc.RTPTransceiverDirectionSendonly,
-	}); err != nil {
-		http.Error(w, "AddTransceiverFromKind error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Create a local H264 track. We're assuming the camera gives H264 NALs.
-	videoTrack, err := webrtc.NewTrackLocalStaticSample(
-		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264},
-		"video", "pion",
-	)
-	if err != nil {
-		http.Error(w, "NewTrackLocalStaticSample error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if _, err := pc.AddTrack(videoTrack); err != nil {
-		http.Error(w, "AddTrack error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+	// Negotiate the "input"/"telemetry" data channels so gamepad input and
+	// OSD stats ride this same PeerConnection instead of a separate
+	// WebSocket.
+	addInputDataChannels(pc)
 
 	// Set remote description (the offer)
 	if err := pc.SetRemoteDescription(offer); err != nil {
@@ -159,25 +127,14 @@ func handleOffer(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(respBytes)
 
-	// Now start pushing camera frames into the track in a goroutine
-	go func() {
-		// If device.GetOutput closes on device.Stop, this loop will exit.
-		for frame := range dev.GetOutput() {
-			// frame.Data should contain H264 NALs if camera was opened with H264
-			if len(frame) == 0 {
-				continue
-			}
-
-			// Write sample; Duration approximates 30fps
-			err := videoTrack.WriteSample(media.Sample{
-				Data:     frame,
-				Duration: time.Second / 30,
-			})
-			if err != nil {
-				log.Printf("videoTrack WriteSample error: %v", err)
-				// If WriteSample fails, break to avoid tight error loop
-				return
-			}
+	// Stream via the Hub rather than reading dev.GetOutput() directly, so
+	// this viewer doesn't steal frames from any other /offer or /whep
+	// viewer watching concurrently.
+	ctx, cancel := context.WithCancel(context.Background())
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			cancel()
 		}
-	}()
+	})
+	go streamToTrack(ctx, videoTrack)
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// whepResourcePrefix is the path every WHEP session resource lives under,
+// e.g. "/whep/1690000000000000000-1".
+const whepResourcePrefix = "/whep/"
+
+// whepSession is the server-side state for one WHEP viewer: the
+// PeerConnection and track it answered with, plus a cancel func to stop the
+// goroutine feeding that track.
+type whepSession struct {
+	pc     *webrtc.PeerConnection
+	track  *webrtc.TrackLocalStaticSample
+	cancel context.CancelFunc
+}
+
+var (
+	whepSessionsMu  sync.Mutex
+	whepSessions    = map[string]*whepSession{}
+	whepResourceSeq uint64
+)
+
+// nextWhepID returns a unique, URL-safe resource ID for a new WHEP session.
+func nextWhepID() string {
+	whepSessionsMu.Lock()
+	defer whepSessionsMu.Unlock()
+	whepResourceSeq++
+	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), whepResourceSeq)
+}
+
+// handleWhep implements the WHEP (WebRTC-HTTP Egress Protocol) endpoint for
+// viewers: POST creates a session from an SDP offer and returns the SDP
+// answer, PATCH carries trickle ICE candidates, DELETE tears the session
+// down. This lets off-the-shelf WHEP players connect without the custom
+// JSON envelope /offer uses.
+func handleWhep(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		handleWhepPost(w, r)
+	case http.MethodPatch:
+		handleWhepPatch(w, r)
+	case http.MethodDelete:
+		handleWhepDelete(w, r)
+	case http.MethodOptions:
+		w.Header().Set("Allow", "POST, PATCH, DELETE, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleWhepPost(w http.ResponseWriter, r *http.Request) {
+	if initDevice() == nil {
+		http.Error(w, "camera init failed", http.StatusInternalServerError)
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "application/sdp" {
+		http.Error(w, "expected Content-Type: application/sdp", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "read body error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(body)}
+
+	pc, videoTrack, sender, err := newVideoPeerConnection()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	go watchRTCP(sender, getHub())
+
+	// Negotiate the "input"/"telemetry" data channels so gamepad input and
+	// OSD stats ride this same PeerConnection instead of a separate
+	// WebSocket.
+	addInputDataChannels(pc)
+
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		pc.Close()
+		http.Error(w, "SetRemoteDescription error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		pc.Close()
+		http.Error(w, "CreateAnswer error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		pc.Close()
+		http.Error(w, "SetLocalDescription error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	<-webrtc.GatheringCompletePromise(pc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	id := nextWhepID()
+	sess := &whepSession{pc: pc, track: videoTrack, cancel: cancel}
+
+	whepSessionsMu.Lock()
+	whepSessions[id] = sess
+	whepSessionsMu.Unlock()
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			removeWhepSession(id)
+		}
+	})
+
+	go streamToTrack(ctx, videoTrack)
+
+	w.Header().Set("Content-Type", "application/sdp")
+	w.Header().Set("Location", whepResourcePrefix+id)
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, pc.LocalDescription().SDP)
+}
+
+func handleWhepPatch(w http.ResponseWriter, r *http.Request) {
+	sess := lookupWhepSession(whepIDFromPath(r.URL.Path))
+	if sess == nil {
+		http.Error(w, "no such session", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "read body error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	for _, candidate := range parseTrickleICESDPFrag(string(body)) {
+		if err := sess.pc.AddICECandidate(candidate); err != nil {
+			http.Error(w, "AddICECandidate error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseTrickleICESDPFrag extracts ICE candidates from an
+// application/trickle-ice-sdpfrag body: one or more "a=candidate:..." lines,
+// possibly alongside "a=mid:"/"a=end-of-candidates". Pion's AddICECandidate
+// only strips a leading "candidate:" prefix, not "a=", and expects one
+// candidate per call, so each candidate line needs pulling out on its own.
+func parseTrickleICESDPFrag(body string) []webrtc.ICECandidateInit {
+	var candidates []webrtc.ICECandidateInit
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "a=")
+		if !strings.HasPrefix(line, "candidate:") {
+			continue
+		}
+		candidates = append(candidates, webrtc.ICECandidateInit{Candidate: line})
+	}
+	return candidates
+}
+
+func handleWhepDelete(w http.ResponseWriter, r *http.Request) {
+	if !removeWhepSession(whepIDFromPath(r.URL.Path)) {
+		http.Error(w, "no such session", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func whepIDFromPath(path string) string {
+	return strings.TrimPrefix(path, whepResourcePrefix)
+}
+
+func lookupWhepSession(id string) *whepSession {
+	whepSessionsMu.Lock()
+	defer whepSessionsMu.Unlock()
+	return whepSessions[id]
+}
+
+func removeWhepSession(id string) bool {
+	whepSessionsMu.Lock()
+	sess, ok := whepSessions[id]
+	if ok {
+		delete(whepSessions, id)
+	}
+	whepSessionsMu.Unlock()
+
+	if !ok {
+		return false
+	}
+	sess.cancel()
+	sess.pc.Close()
+	return true
+}
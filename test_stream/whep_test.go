@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestParseTrickleICESDPFrag(t *testing.T) {
+	body := "a=candidate:1 1 UDP 2130706431 192.168.1.5 5000 typ host\r\n" +
+		"a=candidate:2 1 UDP 1694498815 203.0.113.1 5001 typ srflx\n" +
+		"a=end-of-candidates\n"
+
+	got := parseTrickleICESDPFrag(body)
+	want := []webrtc.ICECandidateInit{
+		{Candidate: "candidate:1 1 UDP 2130706431 192.168.1.5 5000 typ host"},
+		{Candidate: "candidate:2 1 UDP 1694498815 203.0.113.1 5001 typ srflx"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d candidates, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("candidate %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseTrickleICESDPFragNoCandidates(t *testing.T) {
+	if got := parseTrickleICESDPFrag("a=mid:0\n"); got != nil {
+		t.Fatalf("parseTrickleICESDPFrag = %+v, want nil", got)
+	}
+}
+
+func TestParseTrickleICESDPFragBareCandidateLine(t *testing.T) {
+	got := parseTrickleICESDPFrag("candidate:3 1 UDP 1 10.0.0.1 5002 typ host\n")
+	if len(got) != 1 || got[0].Candidate != "candidate:3 1 UDP 1 10.0.0.1 5002 typ host" {
+		t.Fatalf("got %+v", got)
+	}
+}